@@ -0,0 +1,90 @@
+package generate
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/driver/kubernetes"
+	"github.com/spf13/cobra"
+)
+
+// WorkspaceContext bundles the resolved workspace state GenerateKubeManifest
+// needs: the configured driver plus the parsed/merged devcontainer config,
+// image and mount a `devpod up` on this workspace would use.
+type WorkspaceContext struct {
+	Driver         kubernetes.KubeManifestGenerator
+	ParsedConfig   *config.DevContainerConfig
+	MergedConfig   *config.MergedDevContainerConfig
+	ImageName      string
+	WorkspaceMount string
+	Labels         []string
+	ImageDetails   *config.ImageDetails
+}
+
+// WorkspaceLoader resolves the current workspace the same way `devpod up`
+// does, so `devpod generate kube` renders the manifest the next `up` would
+// actually create. Workspace resolution (devcontainer.json parsing, config
+// merging, image building) is owned by the root command, not this package -
+// it's injected here rather than re-implemented.
+type WorkspaceLoader func(ctx context.Context) (*WorkspaceContext, error)
+
+// KubeCmd holds the flags for "devpod generate kube".
+type KubeCmd struct {
+	Output string
+	File   string
+
+	loadWorkspace WorkspaceLoader
+}
+
+// NewKubeCmd renders the Pod, PVC and ServiceAccount devpod would otherwise
+// create on the fly as a Kubernetes manifest, so it can be handed to teammates
+// or checked into GitOps and `kubectl apply`'d without invoking devpod at all.
+// loadWorkspace resolves the workspace to render; the root command supplies it.
+func NewKubeCmd(loadWorkspace WorkspaceLoader) *cobra.Command {
+	cmd := &KubeCmd{loadWorkspace: loadWorkspace}
+	kubeCmd := &cobra.Command{
+		Use:   "kube",
+		Short: "Generate a Kubernetes manifest for a devcontainer",
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context())
+		},
+	}
+
+	kubeCmd.Flags().StringVar(&cmd.Output, "output", "yaml", "Output format, one of: yaml|json")
+	kubeCmd.Flags().StringVar(&cmd.File, "file", "", "Write the manifest to this file instead of stdout")
+	return kubeCmd
+}
+
+func (cmd *KubeCmd) Run(ctx context.Context) error {
+	workspace, err := cmd.loadWorkspace(ctx)
+	if err != nil {
+		return fmt.Errorf("resolve workspace: %w", err)
+	}
+
+	manifest, err := workspace.Driver.GenerateKubeManifest(
+		ctx,
+		workspace.ParsedConfig,
+		workspace.MergedConfig,
+		workspace.ImageName,
+		workspace.WorkspaceMount,
+		workspace.Labels,
+		workspace.ImageDetails,
+	)
+	if err != nil {
+		return fmt.Errorf("generate kube manifest: %w", err)
+	}
+
+	raw, err := kubernetes.RenderManifest(manifest, cmd.Output)
+	if err != nil {
+		return err
+	}
+
+	if cmd.File != "" {
+		return os.WriteFile(cmd.File, raw, 0644)
+	}
+
+	_, err = os.Stdout.Write(raw)
+	return err
+}
@@ -0,0 +1,60 @@
+package up
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/loft-sh/devpod/pkg/driver/kubernetes"
+	"github.com/spf13/cobra"
+)
+
+// WorkspaceApplier resolves the driver a `--kube-file` apply should run
+// against the same way `devpod up` resolves the provider for a workspace.
+// Driver resolution (provider config loading, credential setup) is owned by
+// the root command, not this package - it's injected here rather than
+// re-implemented.
+type WorkspaceApplier func(ctx context.Context) (kubernetes.KubeManifestApplier, error)
+
+// UpCmd holds the flags for "devpod up --kube-file".
+type UpCmd struct {
+	KubeFile string
+
+	loadApplier WorkspaceApplier
+}
+
+// NewUpCmd consumes a manifest `devpod generate kube` produced earlier
+// instead of re-deriving one from the devcontainer config, so a manifest
+// checked into GitOps (and possibly hand-edited) is what actually gets
+// applied. loadApplier resolves the driver to apply it with; the root
+// command supplies it.
+func NewUpCmd(loadApplier WorkspaceApplier) *cobra.Command {
+	cmd := &UpCmd{loadApplier: loadApplier}
+	upCmd := &cobra.Command{
+		Use:   "up",
+		Short: "Start a devcontainer",
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context())
+		},
+	}
+
+	upCmd.Flags().StringVar(&cmd.KubeFile, "kube-file", "", "Create the workspace from this Kubernetes manifest instead of deriving one from the devcontainer config")
+	return upCmd
+}
+
+func (cmd *UpCmd) Run(ctx context.Context) error {
+	if cmd.KubeFile == "" {
+		return nil
+	}
+
+	manifest, err := kubernetes.LoadManifestFile(cmd.KubeFile)
+	if err != nil {
+		return fmt.Errorf("load kube manifest: %w", err)
+	}
+
+	applier, err := cmd.loadApplier(ctx)
+	if err != nil {
+		return fmt.Errorf("resolve workspace: %w", err)
+	}
+
+	return applier.ApplyKubeManifest(ctx, manifest)
+}
@@ -0,0 +1,400 @@
+package kubernetes
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// KubeClient is a typed alternative to shelling out to the kubectl binary and
+// parsing its buffered output. clientGoKubeClient backs it with client-go
+// typed clientsets; execKubeClient falls back to the kubectl binary
+// for environments without in-cluster credentials.
+type KubeClient interface {
+	// CreateNamespace creates the namespace, returning nil if it already
+	// exists.
+	CreateNamespace(ctx context.Context, name string) error
+	// GetPVC returns the named PersistentVolumeClaim, or nil if it doesn't
+	// exist.
+	GetPVC(ctx context.Context, namespace, name string) (*corev1.PersistentVolumeClaim, error)
+	// CreatePVC creates the PersistentVolumeClaim; one that already exists is
+	// not an error. The client-go implementation then returns the existing
+	// claim, the kubectl fallback returns pvc as passed in.
+	CreatePVC(ctx context.Context, namespace string, pvc *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaim, error)
+	// CreateServiceAccount creates the named ServiceAccount; one that already
+	// exists is not an error. The client-go implementation then returns the
+	// existing one, the kubectl fallback returns the object it submitted.
+	CreateServiceAccount(ctx context.Context, namespace, name string) (*corev1.ServiceAccount, error)
+	// GetConfigMap returns the named ConfigMap, or nil if it doesn't exist.
+	GetConfigMap(ctx context.Context, namespace, name string) (*corev1.ConfigMap, error)
+	// CreateConfigMap creates the ConfigMap; one that already exists is not an
+	// error. The client-go implementation then returns the existing one, the
+	// kubectl fallback returns configMap as passed in.
+	CreateConfigMap(ctx context.Context, namespace string, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error)
+	CreatePod(ctx context.Context, namespace string, pod *corev1.Pod) (*corev1.Pod, error)
+	// WaitPodRunning blocks until the pod reaches PodRunning. The client-go
+	// implementation watches the pod's phase and returns the running pod; the
+	// kubectl fallback polls and returns a nil pod.
+	WaitPodRunning(ctx context.Context, namespace, name string) (*corev1.Pod, error)
+	// CopyToPod copies the local directory at filepath.Join(dir, source) into
+	// target inside container, streaming a tar archive over an exec session.
+	CopyToPod(ctx context.Context, namespace, podName, container, dir, source, target string) error
+}
+
+// kubeClient picks the typed client-go implementation when in-cluster
+// credentials are available, falling back to the kubectl binary otherwise.
+func (k *kubernetesDriver) kubeClient() KubeClient {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		k.Log.Debugf("No in-cluster Kubernetes credentials available, falling back to the kubectl binary: %v", err)
+		return newExecKubeClient(k)
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		k.Log.Debugf("Failed to build a Kubernetes client from in-cluster credentials, falling back to the kubectl binary: %v", err)
+		return newExecKubeClient(k)
+	}
+
+	return &clientGoKubeClient{clientset: clientset, restConfig: restConfig}
+}
+
+type clientGoKubeClient struct {
+	clientset  kubernetes.Interface
+	restConfig *rest.Config
+}
+
+func (c *clientGoKubeClient) CreateNamespace(ctx context.Context, name string) error {
+	_, err := c.clientset.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (c *clientGoKubeClient) GetPVC(ctx context.Context, namespace, name string) (*corev1.PersistentVolumeClaim, error) {
+	pvc, err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return pvc, nil
+}
+
+func (c *clientGoKubeClient) CreatePVC(ctx context.Context, namespace string, pvc *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaim, error) {
+	created, err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, pvc, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		return c.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvc.Name, metav1.GetOptions{})
+	}
+
+	return created, err
+}
+
+func (c *clientGoKubeClient) CreateServiceAccount(ctx context.Context, namespace, name string) (*corev1.ServiceAccount, error) {
+	serviceAccount, err := c.clientset.CoreV1().ServiceAccounts(namespace).Create(ctx, &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: DevPodLabels},
+	}, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		return c.clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+
+	return serviceAccount, err
+}
+
+func (c *clientGoKubeClient) GetConfigMap(ctx context.Context, namespace, name string) (*corev1.ConfigMap, error) {
+	configMap, err := c.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return configMap, nil
+}
+
+func (c *clientGoKubeClient) CreateConfigMap(ctx context.Context, namespace string, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	created, err := c.clientset.CoreV1().ConfigMaps(namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		return c.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, configMap.Name, metav1.GetOptions{})
+	}
+
+	return created, err
+}
+
+func (c *clientGoKubeClient) CreatePod(ctx context.Context, namespace string, pod *corev1.Pod) (*corev1.Pod, error) {
+	return c.clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+}
+
+func (c *clientGoKubeClient) WaitPodRunning(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	watcher, err := c.clientset.CoreV1().Pods(namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "watch pod")
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return nil, fmt.Errorf("watch for pod '%s' closed before it became ready", name)
+			}
+
+			pod, ok := event.Object.(*corev1.Pod)
+			if !ok {
+				continue
+			}
+
+			switch pod.Status.Phase {
+			case corev1.PodRunning:
+				return pod, nil
+			case corev1.PodFailed, corev1.PodSucceeded:
+				return nil, fmt.Errorf("pod '%s' exited with phase %s before becoming ready", name, pod.Status.Phase)
+			}
+		}
+	}
+}
+
+func (c *clientGoKubeClient) CopyToPod(ctx context.Context, namespace, podName, container, dir, source, target string) error {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		pipeWriter.CloseWithError(tarDirectory(filepath.Join(dir, source), pipeWriter))
+	}()
+
+	req := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   []string{"tar", "xf", "-", "-C", target},
+			Stdin:     true,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(c.restConfig, "POST", req.URL())
+	if err != nil {
+		return errors.Wrap(err, "build exec stream")
+	}
+
+	return executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  pipeReader,
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+	})
+}
+
+// tarDirectory writes a tar stream of root to w, for piping into `tar xf -`
+// inside a container over an exec session.
+func tarDirectory(root string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		} else if relPath == "." {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = relPath
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+		return err
+	})
+}
+
+// execKubeClient falls back to the kubectl binary for environments without
+// in-cluster credentials, e.g. no ServiceAccount token mounted.
+type execKubeClient struct {
+	driver *kubernetesDriver
+}
+
+func newExecKubeClient(driver *kubernetesDriver) KubeClient {
+	return &execKubeClient{driver: driver}
+}
+
+func (c *execKubeClient) CreateNamespace(ctx context.Context, name string) error {
+	buf := &bytes.Buffer{}
+	err := c.driver.runCommand(ctx, []string{"create", "ns", name}, nil, buf, buf)
+	if err != nil && !strings.Contains(buf.String(), "AlreadyExists") {
+		return errors.Wrapf(err, "create namespace: %s", buf.String())
+	}
+
+	return nil
+}
+
+func (c *execKubeClient) GetPVC(ctx context.Context, namespace, name string) (*corev1.PersistentVolumeClaim, error) {
+	buf := &bytes.Buffer{}
+	errBuf := &bytes.Buffer{}
+	err := c.driver.runCommand(ctx, []string{"get", "pvc", name, "-o", "json"}, nil, buf, errBuf)
+	if err != nil {
+		if strings.Contains(errBuf.String(), "NotFound") || strings.Contains(errBuf.String(), "not found") {
+			return nil, nil
+		}
+
+		return nil, errors.Wrapf(err, "get pvc: %s", errBuf.String())
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := json.Unmarshal(buf.Bytes(), pvc); err != nil {
+		return nil, errors.Wrap(err, "parse pvc")
+	}
+
+	return pvc, nil
+}
+
+func (c *execKubeClient) CreatePVC(ctx context.Context, namespace string, pvc *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaim, error) {
+	raw, err := json.Marshal(pvc)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	err = c.driver.runCommand(ctx, []string{"create", "-f", "-"}, strings.NewReader(string(raw)), buf, buf)
+	if err != nil && !strings.Contains(buf.String(), "AlreadyExists") {
+		return nil, errors.Wrapf(err, "create pvc: %s", buf.String())
+	}
+
+	return pvc, nil
+}
+
+func (c *execKubeClient) CreateServiceAccount(ctx context.Context, namespace, name string) (*corev1.ServiceAccount, error) {
+	serviceAccount := &corev1.ServiceAccount{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ServiceAccount",
+			APIVersion: corev1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: DevPodLabels},
+	}
+
+	raw, err := json.Marshal(serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	err = c.driver.runCommand(ctx, []string{"create", "-f", "-"}, strings.NewReader(string(raw)), buf, buf)
+	if err != nil && !strings.Contains(buf.String(), "AlreadyExists") {
+		return nil, errors.Wrapf(err, "create service account: %s", buf.String())
+	}
+
+	return serviceAccount, nil
+}
+
+func (c *execKubeClient) GetConfigMap(ctx context.Context, namespace, name string) (*corev1.ConfigMap, error) {
+	buf := &bytes.Buffer{}
+	errBuf := &bytes.Buffer{}
+	err := c.driver.runCommand(ctx, []string{"get", "configmap", name, "-o", "json"}, nil, buf, errBuf)
+	if err != nil {
+		if strings.Contains(errBuf.String(), "NotFound") || strings.Contains(errBuf.String(), "not found") {
+			return nil, nil
+		}
+
+		return nil, errors.Wrapf(err, "get configmap: %s", errBuf.String())
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := json.Unmarshal(buf.Bytes(), configMap); err != nil {
+		return nil, errors.Wrap(err, "parse configmap")
+	}
+
+	return configMap, nil
+}
+
+func (c *execKubeClient) CreateConfigMap(ctx context.Context, namespace string, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	raw, err := json.Marshal(configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	err = c.driver.runCommand(ctx, []string{"create", "-f", "-"}, strings.NewReader(string(raw)), buf, buf)
+	if err != nil && !strings.Contains(buf.String(), "AlreadyExists") {
+		return nil, errors.Wrapf(err, "create configmap: %s", buf.String())
+	}
+
+	return configMap, nil
+}
+
+func (c *execKubeClient) CreatePod(ctx context.Context, namespace string, pod *corev1.Pod) (*corev1.Pod, error) {
+	podRaw, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	err = c.driver.runCommand(ctx, []string{"create", "-f", "-"}, strings.NewReader(string(podRaw)), buf, buf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create pod: %s", buf.String())
+	}
+
+	return pod, nil
+}
+
+func (c *execKubeClient) WaitPodRunning(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	_, err := c.driver.waitPodRunning(ctx, name)
+	return nil, err
+}
+
+func (c *execKubeClient) CopyToPod(ctx context.Context, namespace, podName, container, dir, source, target string) error {
+	buf := &bytes.Buffer{}
+	err := c.driver.runCommandWithDir(ctx, dir, []string{
+		"cp", "-c", container,
+		strings.TrimRight(source, "/") + "/.",
+		fmt.Sprintf("%s:%s", podName, strings.TrimRight(target, "/")),
+	}, nil, buf, buf)
+	if err != nil {
+		return errors.Wrap(err, "copy to devcontainer")
+	}
+
+	return nil
+}
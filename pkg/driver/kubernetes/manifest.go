@@ -0,0 +1,231 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// BuildPodManifestOptions carries everything BuildPodManifest needs to produce a
+// Pod spec without touching the API server, so the same code path can be used to
+// either create the pod or render it for `devpod generate kube`.
+type BuildPodManifestOptions struct {
+	ID              string
+	ImageName       string
+	Entrypoint      string
+	Args            []string
+	ServiceAccount  string
+	InitContainers  []corev1.Container
+	VolumeMounts    []corev1.VolumeMount
+	Capabilities    *corev1.Capabilities
+	EnvVars         []corev1.EnvVar
+	Privileged      *bool
+	Resources       corev1.ResourceRequirements
+	NodeSelectorRaw string
+	SELinuxOptions  *corev1.SELinuxOptions
+	SELinuxMounts   map[string]string
+	Security        *SecurityOptions
+	Volume          corev1.Volume
+	// TopologyConstraints are merged into the pod's node selector when the
+	// workspace volume uses VolumeBindingWaitForFirstConsumer, so the pod
+	// only schedules onto nodes the volume can actually bind on.
+	TopologyConstraints map[string]string
+}
+
+// BuildPodManifest builds the corev1.Pod for a dev container. It is a pure
+// function: no API calls, no side effects. runContainer feeds its result to the
+// Kubernetes API, and `devpod generate kube` feeds it to RenderManifest instead.
+func BuildPodManifest(opts *BuildPodManifestOptions) (*corev1.Pod, error) {
+	podSecurityContext, securityContext := resolveSecurityContext(opts.Security, opts.Capabilities, opts.Privileged)
+	securityContext.SELinuxOptions = opts.SELinuxOptions
+
+	pod := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: corev1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        opts.ID,
+			Labels:      DevPodLabels,
+			Annotations: selinuxMountsAnnotation(opts.SELinuxMounts),
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: opts.ServiceAccount,
+			InitContainers:     opts.InitContainers,
+			SecurityContext:    podSecurityContext,
+			Containers: []corev1.Container{
+				{
+					Name:            "devpod",
+					Image:           opts.ImageName,
+					Command:         []string{opts.Entrypoint},
+					Resources:       opts.Resources,
+					Args:            opts.Args,
+					Env:             opts.EnvVars,
+					VolumeMounts:    opts.VolumeMounts,
+					SecurityContext: securityContext,
+				},
+			},
+			RestartPolicy: corev1.RestartPolicyNever,
+			Volumes:       []corev1.Volume{opts.Volume},
+		},
+	}
+
+	if opts.NodeSelectorRaw != "" {
+		nodeSelector, err := parseLabels(opts.NodeSelectorRaw)
+		if err != nil {
+			return nil, err
+		}
+
+		pod.Spec.NodeSelector = nodeSelector
+	}
+
+	for k, v := range opts.TopologyConstraints {
+		if pod.Spec.NodeSelector == nil {
+			pod.Spec.NodeSelector = map[string]string{}
+		}
+
+		pod.Spec.NodeSelector[k] = v
+	}
+
+	return pod, nil
+}
+
+// KubeManifest bundles the Pod, PVC and ServiceAccount devpod would otherwise
+// create on the fly so they can be rendered once and `kubectl apply`'d
+// independently of devpod, e.g. to hand a devcontainer to teammates or check
+// it into GitOps. The DevContainerInfo ConfigMap RunDevContainer creates is not
+// part of it.
+type KubeManifest struct {
+	Pod            *corev1.Pod                   `json:"pod"`
+	PVC            *corev1.PersistentVolumeClaim `json:"pvc,omitempty"`
+	ServiceAccount *corev1.ServiceAccount        `json:"serviceAccount,omitempty"`
+}
+
+// RenderManifest marshals a KubeManifest as YAML or JSON. Both encoders go
+// through encoding/json first, which sorts map keys and emits struct fields in
+// declaration order, so repeated renders of the same manifest produce
+// byte-identical output.
+func RenderManifest(manifest *KubeManifest, format string) ([]byte, error) {
+	switch format {
+	case "", "yaml":
+		return yaml.Marshal(manifest)
+	case "json":
+		return json.MarshalIndent(manifest, "", "  ")
+	default:
+		return nil, fmt.Errorf("unsupported output format '%s', expected 'yaml' or 'json'", format)
+	}
+}
+
+// buildPvcManifest is the pure counterpart of createPersistentVolumeClaim: it
+// builds the PersistentVolumeClaim the configured WorkspaceVolume backend
+// provisions (nil for backends that don't provision one), annotated with the
+// workspace's DevContainerInfo, without submitting it to the API server.
+// RunDevContainer and StartDevContainer read DevContainerInfo from the
+// ConfigMap named by devContainerInfoConfigMapName, not from this annotation.
+func buildPvcManifest(
+	volume WorkspaceVolume,
+	id string,
+	parsedConfig *config.DevContainerConfig,
+	mergedConfig *config.MergedDevContainerConfig,
+	imageName,
+	workspaceMount string,
+	labels []string,
+	imageDetails *config.ImageDetails,
+) *corev1.PersistentVolumeClaim {
+	infoRaw, err := json.Marshal(&DevContainerInfo{
+		ParsedConfig:           parsedConfig,
+		MergedConfig:           mergedConfig,
+		ImageDetails:           imageDetails,
+		ImageName:              imageName,
+		WorkspaceMount:         workspaceMount,
+		Labels:                 labels,
+		WorkspaceVolumeBackend: volume.Backend(),
+	})
+	if err != nil {
+		infoRaw = []byte("{}")
+	}
+
+	return volume.BuildPVC(id, DevPodLabels, map[string]string{
+		DevContainerInfoAnnotation: string(infoRaw),
+	})
+}
+
+// devContainerInfoConfigMapName is where RunDevContainer persists a
+// workspace's DevContainerInfo so StartDevContainer can reconstruct it later.
+// Unlike the PVC annotation above - which only exists for the pvc backend,
+// and only once devpod itself provisions the claim - this ConfigMap is
+// created for every workspace volume backend, so a CSI-inline (named claim)
+// or network-fs workspace can be restarted too.
+func devContainerInfoConfigMapName(id string) string {
+	return id + "-devpod-info"
+}
+
+// buildDevContainerInfoConfigMap builds the ConfigMap RunDevContainer
+// persists a workspace's DevContainerInfo to.
+func buildDevContainerInfoConfigMap(id string, info *DevContainerInfo) (*corev1.ConfigMap, error) {
+	infoRaw, err := json.Marshal(info)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal devcontainer info")
+	}
+
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: corev1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   devContainerInfoConfigMapName(id),
+			Labels: DevPodLabels,
+		},
+		Data: map[string]string{
+			DevContainerInfoAnnotation: string(infoRaw),
+		},
+	}, nil
+}
+
+// devContainerInfoFromConfigMap parses the DevContainerInfo persisted in a
+// ConfigMap built by buildDevContainerInfoConfigMap.
+func devContainerInfoFromConfigMap(configMap *corev1.ConfigMap) (*DevContainerInfo, error) {
+	raw, ok := configMap.Data[DevContainerInfoAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	containerInfo := &DevContainerInfo{}
+	if err := json.Unmarshal([]byte(raw), containerInfo); err != nil {
+		return nil, errors.Wrap(err, "parse devcontainer info")
+	}
+
+	return containerInfo, nil
+}
+
+// LoadManifest parses a file produced by RenderManifest back into its objects,
+// so `devpod up --kube-file` can reuse them instead of re-deriving the pod spec.
+func LoadManifest(raw []byte) (*KubeManifest, error) {
+	manifest := &KubeManifest{}
+	if err := yaml.Unmarshal(raw, manifest); err != nil {
+		return nil, fmt.Errorf("parse kube manifest: %w", err)
+	} else if manifest.Pod == nil {
+		return nil, fmt.Errorf("kube manifest has no pod")
+	}
+
+	return manifest, nil
+}
+
+// LoadManifestFile reads and parses the file at path with LoadManifest, so
+// `devpod up --kube-file <file>` is a one-line call instead of duplicating the
+// read-then-parse at the call site.
+func LoadManifestFile(path string) (*KubeManifest, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read kube manifest file: %w", err)
+	}
+
+	return LoadManifest(raw)
+}
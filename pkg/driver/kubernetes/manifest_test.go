@@ -0,0 +1,77 @@
+package kubernetes
+
+import (
+	"bytes"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func metav1ObjectMeta(name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name}
+}
+
+func TestRenderAndLoadManifestRoundTrip(t *testing.T) {
+	manifest := &KubeManifest{
+		Pod: &corev1.Pod{
+			ObjectMeta: metav1ObjectMeta("my-id"),
+		},
+		PVC: &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1ObjectMeta("my-id"),
+		},
+	}
+
+	for _, format := range []string{"yaml", "json", ""} {
+		t.Run(format, func(t *testing.T) {
+			raw, err := RenderManifest(manifest, format)
+			if err != nil {
+				t.Fatalf("RenderManifest: %v", err)
+			}
+
+			loaded, err := LoadManifest(raw)
+			if err != nil {
+				t.Fatalf("LoadManifest: %v", err)
+			}
+			if loaded.Pod.Name != manifest.Pod.Name {
+				t.Errorf("Pod.Name = %q, want %q", loaded.Pod.Name, manifest.Pod.Name)
+			}
+			if loaded.PVC == nil || loaded.PVC.Name != manifest.PVC.Name {
+				t.Errorf("PVC = %+v, want name %q", loaded.PVC, manifest.PVC.Name)
+			}
+		})
+	}
+}
+
+func TestRenderManifestIsDeterministic(t *testing.T) {
+	manifest := &KubeManifest{
+		Pod: &corev1.Pod{
+			ObjectMeta: metav1ObjectMeta("my-id"),
+		},
+	}
+
+	first, err := RenderManifest(manifest, "yaml")
+	if err != nil {
+		t.Fatalf("RenderManifest: %v", err)
+	}
+	second, err := RenderManifest(manifest, "yaml")
+	if err != nil {
+		t.Fatalf("RenderManifest: %v", err)
+	}
+
+	if !bytes.Equal(first, second) {
+		t.Errorf("repeated renders of the same manifest are not byte-identical:\n%s\n---\n%s", first, second)
+	}
+}
+
+func TestRenderManifestUnsupportedFormat(t *testing.T) {
+	if _, err := RenderManifest(&KubeManifest{Pod: &corev1.Pod{}}, "toml"); err == nil {
+		t.Error("expected an error for an unsupported output format")
+	}
+}
+
+func TestLoadManifestRequiresPod(t *testing.T) {
+	if _, err := LoadManifest([]byte("pvc: {}\n")); err == nil {
+		t.Error("expected an error when the manifest has no pod")
+	}
+}
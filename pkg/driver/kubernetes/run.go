@@ -1,13 +1,11 @@
 package kubernetes
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strconv"
-	"strings"
 
 	config2 "github.com/loft-sh/devpod/pkg/config"
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
@@ -19,6 +17,32 @@ import (
 
 const DevContainerInfoAnnotation = "devpod.sh/info"
 
+// KubeManifestGenerator is the subset of the Kubernetes driver that `devpod
+// generate kube` needs. The *kubernetesDriver built for a workspace's
+// provider satisfies it; it's exported as an interface (rather than the
+// unexported driver type) so callers outside this package can depend on it
+// without reaching into driver internals.
+type KubeManifestGenerator interface {
+	GenerateKubeManifest(
+		ctx context.Context,
+		parsedConfig *config.DevContainerConfig,
+		mergedConfig *config.MergedDevContainerConfig,
+		imageName,
+		workspaceMount string,
+		labels []string,
+		imageDetails *config.ImageDetails,
+	) (*KubeManifest, error)
+}
+
+// KubeManifestApplier is the subset of the Kubernetes driver that `devpod up
+// --kube-file` needs to create a workspace straight from a manifest instead
+// of re-deriving one. Exported as an interface for the same reason as
+// KubeManifestGenerator: callers outside this package depend on it without
+// reaching into driver internals.
+type KubeManifestApplier interface {
+	ApplyKubeManifest(ctx context.Context, manifest *KubeManifest) error
+}
+
 var DevPodLabels = map[string]string{
 	"devpod.sh/created": "true",
 }
@@ -30,6 +54,11 @@ type DevContainerInfo struct {
 	ImageName      string
 	WorkspaceMount string
 	Labels         []string
+
+	// WorkspaceVolumeBackend pins the workspace volume backend this workspace
+	// was created with, so StartDevContainer reconstructs the same volume
+	// topology even if the provider's default backend option changes later.
+	WorkspaceVolumeBackend WorkspaceVolumeBackend
 }
 
 func (k *kubernetesDriver) RunDevContainer(
@@ -48,33 +77,70 @@ func (k *kubernetesDriver) RunDevContainer(
 		return err
 	}
 
+	kubeClient := k.kubeClient()
+
 	// namespace
 	if k.namespace != "" && k.config.CreateNamespace == "true" {
 		k.Log.Debugf("Create namespace '%s'", k.namespace)
-		buf := &bytes.Buffer{}
-		err := k.runCommand(ctx, []string{"create", "ns", k.namespace}, nil, buf, buf)
-		if err != nil {
+		if err := kubeClient.CreateNamespace(ctx, k.namespace); err != nil {
 			k.Log.Debugf("Error creating namespace: %v", err)
 		}
 	}
 
-	// check if persistent volume claim already exists
-	initialize := false
-	pvc, _, err := k.getDevContainerPvc(ctx, id)
+	// Whether devpod has already created this workspace is tracked by the
+	// DevContainerInfo ConfigMap, not the PVC: CSI-inline (named claim) and
+	// network-fs backends never provision a PVC of their own, so checking for
+	// one would make every `up` on those backends look like a first creation.
+	containerInfoCM, err := kubeClient.GetConfigMap(ctx, k.namespace, devContainerInfoConfigMapName(id))
 	if err != nil {
 		return err
-	} else if pvc == nil {
-		// create persistent volume claim
-		err = k.createPersistentVolumeClaim(ctx, id, parsedConfig, mergedConfig, imageName, workspaceMount, labels, imageDetails)
+	}
+
+	backend := k.workspaceVolumeOptions().Backend
+	initialize := containerInfoCM == nil
+	if !initialize {
+		containerInfo, err := devContainerInfoFromConfigMap(containerInfoCM)
+		if err != nil {
+			return err
+		} else if containerInfo != nil {
+			backend = containerInfo.WorkspaceVolumeBackend
+		}
+	}
+	if initialize {
+		workspaceVolume := NewWorkspaceVolume(k.workspaceVolumeOptions())
+		if workspaceVolume.Backend() == WorkspaceVolumeBackendPVC {
+			err = k.createPersistentVolumeClaim(ctx, id, parsedConfig, mergedConfig, imageName, workspaceMount, labels, imageDetails)
+			if err != nil {
+				return err
+			}
+		} else if pvc := buildPvcManifest(workspaceVolume, id, parsedConfig, mergedConfig, imageName, workspaceMount, labels, imageDetails); pvc != nil {
+			if _, err := kubeClient.CreatePVC(ctx, k.namespace, pvc); err != nil {
+				return errors.Wrap(err, "create pvc")
+			}
+		}
+
+		configMap, err := buildDevContainerInfoConfigMap(id, &DevContainerInfo{
+			ParsedConfig:           parsedConfig,
+			MergedConfig:           mergedConfig,
+			ImageDetails:           imageDetails,
+			ImageName:              imageName,
+			WorkspaceMount:         workspaceMount,
+			Labels:                 labels,
+			WorkspaceVolumeBackend: backend,
+		})
 		if err != nil {
 			return err
 		}
 
-		initialize = true
+		if _, err := kubeClient.CreateConfigMap(ctx, k.namespace, configMap); err != nil {
+			return err
+		}
 	}
 
-	// create dev container
-	err = k.runContainer(ctx, id, parsedConfig, mergedConfig, imageName, workspaceMount, imageDetails, initialize)
+	// create dev container. On the first creation of the workspace the live
+	// provider option picks the backend; an existing workspace keeps the
+	// backend persisted in its DevContainerInfo ConfigMap.
+	err = k.runContainer(ctx, id, parsedConfig, mergedConfig, imageName, workspaceMount, imageDetails, initialize, backend)
 	if err != nil {
 		return err
 	}
@@ -91,7 +157,10 @@ func (k *kubernetesDriver) runContainer(
 	workspaceMount string,
 	imageDetails *config.ImageDetails,
 	initialize bool,
+	volumeBackend WorkspaceVolumeBackend,
 ) (err error) {
+	kubeClient := k.kubeClient()
+
 	// get workspace mount
 	mount := config.ParseMount(workspaceMount)
 	if mount.Target == "" {
@@ -107,13 +176,27 @@ func (k *kubernetesDriver) runContainer(
 		}
 	}
 
+	// workspace volume backend - PVC-with-cp (default), CSI-inline, or
+	// network-fs. volumeBackend is whatever the workspace was created with
+	// (passed in by the caller from the persisted DevContainerInfo on
+	// restart), so a later provider option change doesn't strand an existing
+	// workspace with the wrong backend.
+	volumeOptions := k.workspaceVolumeOptions()
+	volumeOptions.Backend = volumeBackend
+	workspaceVolume := NewWorkspaceVolume(volumeOptions)
+
 	// loop over volume mounts
-	copyFromLocal := []*config.Mount{&mount}
+	copyFromLocal := []*config.Mount{}
+	if workspaceVolume.NeedsCopy() {
+		copyFromLocal = append(copyFromLocal, &mount)
+	}
 	volumeMounts := []corev1.VolumeMount{getVolumeMount(0, &mount)}
 	for idx, mount := range mergedConfig.Mounts {
 		volumeMount := getVolumeMount(idx+1, mount)
 		if mount.Type == "bind" {
-			copyFromLocal = append(copyFromLocal, mount)
+			if workspaceVolume.NeedsCopy() {
+				copyFromLocal = append(copyFromLocal, mount)
+			}
 			volumeMounts = append(volumeMounts, volumeMount)
 		} else if mount.Type == "volume" {
 			volumeMounts = append(volumeMounts, volumeMount)
@@ -122,6 +205,14 @@ func (k *kubernetesDriver) runContainer(
 		}
 	}
 
+	// security context. When the resolved UID (explicit RunAsUser, or the
+	// PodSecurityStandard preset's default) is non-root, prepend a chown of
+	// the PVC's devpod/ subpaths so the container user can write to it.
+	security := k.securityOptions()
+	if uid, gid := security.effectiveUserGroup(); initialize && uid != 0 {
+		initContainer = append([]corev1.Container{buildChownInitContainer(imageName, uid, gid, volumeMounts)}, initContainer...)
+	}
+
 	// capabilities
 	var capabilities *corev1.Capabilities
 	if len(mergedConfig.CapAdd) > 0 {
@@ -131,14 +222,15 @@ func (k *kubernetesDriver) runContainer(
 		}
 	}
 
-	// env vars
-	envVars := []corev1.EnvVar{}
-	for k, v := range mergedConfig.ContainerEnv {
-		envVars = append(envVars, corev1.EnvVar{
-			Name:  k,
-			Value: v,
-		})
-	}
+	// SELinux mount options. Computed from the same workspace mount and merged
+	// mounts that get persisted in the DevContainerInfo ConfigMap, so
+	// StartDevContainer re-derives and re-applies the same relabeling when it
+	// restarts an existing workspace.
+	selinuxMounts := collectSELinuxMounts(&mount, mergedConfig.Mounts)
+
+	// env vars, sorted by name so repeated renders of the same devcontainer
+	// don't reorder Env depending on Go's randomized map iteration.
+	envVars := envVarsFromContainerEnv(mergedConfig.ContainerEnv)
 
 	// service account
 	serviceAccount := ""
@@ -146,7 +238,7 @@ func (k *kubernetesDriver) runContainer(
 		serviceAccount = k.config.ServiceAccount
 
 		// create service account
-		err = k.createServiceAccount(ctx, id, serviceAccount)
+		_, err = kubeClient.CreateServiceAccount(ctx, k.namespace, serviceAccount)
 		if err != nil {
 			return fmt.Errorf("create service account: %w", err)
 		}
@@ -154,75 +246,41 @@ func (k *kubernetesDriver) runContainer(
 
 	// create the pod manifest
 	entrypoint, args := docker.GetContainerEntrypointAndArgs(mergedConfig, imageDetails)
-	pod := &corev1.Pod{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "Pod",
-			APIVersion: corev1.SchemeGroupVersion.String(),
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:   id,
-			Labels: DevPodLabels,
-		},
-		Spec: corev1.PodSpec{
-			ServiceAccountName: serviceAccount,
-			InitContainers:     initContainer,
-			Containers: []corev1.Container{
-				{
-					Name:         "devpod",
-					Image:        imageName,
-					Command:      []string{entrypoint},
-					Resources:    parseResources(k.config.Resources, k.Log),
-					Args:         args,
-					Env:          envVars,
-					VolumeMounts: volumeMounts,
-					SecurityContext: &corev1.SecurityContext{
-						Capabilities: capabilities,
-						Privileged:   mergedConfig.Privileged,
-						RunAsUser:    &[]int64{0}[0],
-						RunAsGroup:   &[]int64{0}[0],
-						RunAsNonRoot: &[]bool{false}[0],
-					},
-				},
-			},
-			RestartPolicy: corev1.RestartPolicyNever,
-			Volumes: []corev1.Volume{
-				{
-					Name: "devpod",
-					VolumeSource: corev1.VolumeSource{
-						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-							ClaimName: id,
-						},
-					},
-				},
-			},
-		},
-	}
-
-	// parse node selector
-	if k.config.NodeSelector != "" {
-		pod.Spec.NodeSelector, err = parseLabels(k.config.NodeSelector)
-		if err != nil {
-			return fmt.Errorf("parsing node selector: %w", err)
-		}
-	}
-
-	// marshal the pod
-	podRaw, err := json.Marshal(pod)
+	pod, err := BuildPodManifest(&BuildPodManifestOptions{
+		ID:                  id,
+		ImageName:           imageName,
+		Entrypoint:          entrypoint,
+		Args:                args,
+		ServiceAccount:      serviceAccount,
+		InitContainers:      initContainer,
+		VolumeMounts:        volumeMounts,
+		Capabilities:        capabilities,
+		EnvVars:             envVars,
+		Privileged:          mergedConfig.Privileged,
+		Resources:           parseResources(k.config.Resources, k.Log),
+		NodeSelectorRaw:     k.config.NodeSelector,
+		SELinuxOptions:      seLinuxOptionsFromMounts(selinuxMounts),
+		SELinuxMounts:       selinuxMounts,
+		Security:            security,
+		Volume:              workspaceVolume.Build(id),
+		TopologyConstraints: waitForFirstConsumerTopology(volumeOptions),
+	})
 	if err != nil {
 		return err
 	}
 
-	// create the pod
+	// create the pod via the typed KubeClient (falls back to the kubectl
+	// binary when in-cluster credentials aren't available)
 	k.Log.Infof("Create Pod '%s'", id)
-	buf := &bytes.Buffer{}
-	err = k.runCommand(ctx, []string{"create", "-f", "-"}, strings.NewReader(string(podRaw)), buf, buf)
+	_, err = kubeClient.CreatePod(ctx, k.namespace, pod)
 	if err != nil {
-		return errors.Wrapf(err, "create pod: %s", buf.String())
+		return errors.Wrap(err, "create pod")
 	}
 
-	// wait for pod running
+	// wait for pod running - the client-go KubeClient watches the pod's phase,
+	// the kubectl fallback polls
 	k.Log.Infof("Waiting for DevContainer Pod '%s' to come up...", id)
-	_, err = k.waitPodRunning(ctx, id)
+	_, err = kubeClient.WaitPodRunning(ctx, k.namespace, id)
 	if err != nil {
 		return err
 	}
@@ -230,10 +288,8 @@ func (k *kubernetesDriver) runContainer(
 	// copy local to pod
 	if initialize {
 		for _, copyMount := range copyFromLocal {
-			// run kubectl
 			k.Log.Infof("Copy %s into DevContainer %s", copyMount.Source, copyMount.Target)
-			buf := &bytes.Buffer{}
-			err = k.runCommandWithDir(ctx, filepath.Dir(parsedConfig.Origin), []string{"cp", "-c", "devpod", strings.TrimRight(copyMount.Source, "/") + "/.", fmt.Sprintf("%s:%s", id, strings.TrimRight(copyMount.Target, "/"))}, nil, buf, buf)
+			err = kubeClient.CopyToPod(ctx, k.namespace, id, "devpod", filepath.Dir(parsedConfig.Origin), copyMount.Source, copyMount.Target)
 			if err != nil {
 				return errors.Wrap(err, "copy to devcontainer")
 			}
@@ -243,6 +299,27 @@ func (k *kubernetesDriver) runContainer(
 	return nil
 }
 
+// envVarsFromContainerEnv builds the pod's env vars from ContainerEnv,
+// sorted by name so two renders of the same devcontainer produce identical
+// output instead of depending on Go's randomized map iteration order.
+func envVarsFromContainerEnv(containerEnv map[string]string) []corev1.EnvVar {
+	names := make([]string, 0, len(containerEnv))
+	for name := range containerEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	envVars := []corev1.EnvVar{}
+	for _, name := range names {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  name,
+			Value: containerEnv[name],
+		})
+	}
+
+	return envVars
+}
+
 func getVolumeMount(idx int, mount *config.Mount) corev1.VolumeMount {
 	subPath := strconv.Itoa(idx)
 	if mount.Type == "volume" && mount.Source != "" {
@@ -256,12 +333,153 @@ func getVolumeMount(idx int, mount *config.Mount) corev1.VolumeMount {
 	}
 }
 
+// GenerateKubeManifest builds the Pod, PVC and (if configured) ServiceAccount for
+// a dev container without talking to the API server, so `devpod generate kube`
+// can render them to a file instead of creating them. It mirrors runContainer's
+// object-building steps but never shells out to kubectl.
+func (k *kubernetesDriver) GenerateKubeManifest(
+	ctx context.Context,
+	parsedConfig *config.DevContainerConfig,
+	mergedConfig *config.MergedDevContainerConfig,
+	imageName,
+	workspaceMount string,
+	labels []string,
+	imageDetails *config.ImageDetails,
+) (*KubeManifest, error) {
+	id, err := k.getID(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	mount := config.ParseMount(workspaceMount)
+	if mount.Target == "" {
+		return nil, fmt.Errorf("workspace mount target is empty")
+	}
+
+	initContainer, err := k.getInitContainer(mergedConfig, imageName)
+	if err != nil {
+		return nil, errors.Wrap(err, "build init container")
+	}
+
+	volumeMounts := []corev1.VolumeMount{getVolumeMount(0, &mount)}
+	for idx, m := range mergedConfig.Mounts {
+		if m.Type == "bind" || m.Type == "volume" {
+			volumeMounts = append(volumeMounts, getVolumeMount(idx+1, m))
+		}
+	}
+
+	var capabilities *corev1.Capabilities
+	if len(mergedConfig.CapAdd) > 0 {
+		capabilities = &corev1.Capabilities{}
+		for _, cap := range mergedConfig.CapAdd {
+			capabilities.Add = append(capabilities.Add, corev1.Capability(cap))
+		}
+	}
+
+	envVars := envVarsFromContainerEnv(mergedConfig.ContainerEnv)
+
+	security := k.securityOptions()
+	if uid, gid := security.effectiveUserGroup(); uid != 0 {
+		initContainer = append([]corev1.Container{buildChownInitContainer(imageName, uid, gid, volumeMounts)}, initContainer...)
+	}
+
+	selinuxMounts := collectSELinuxMounts(&mount, mergedConfig.Mounts)
+	workspaceVolume := NewWorkspaceVolume(k.workspaceVolumeOptions())
+
+	serviceAccountName := k.config.ServiceAccount
+	entrypoint, args := docker.GetContainerEntrypointAndArgs(mergedConfig, imageDetails)
+	pod, err := BuildPodManifest(&BuildPodManifestOptions{
+		ID:                  id,
+		ImageName:           imageName,
+		Entrypoint:          entrypoint,
+		Args:                args,
+		ServiceAccount:      serviceAccountName,
+		InitContainers:      initContainer,
+		VolumeMounts:        volumeMounts,
+		Capabilities:        capabilities,
+		EnvVars:             envVars,
+		Privileged:          mergedConfig.Privileged,
+		Resources:           parseResources(k.config.Resources, k.Log),
+		NodeSelectorRaw:     k.config.NodeSelector,
+		SELinuxOptions:      seLinuxOptionsFromMounts(selinuxMounts),
+		SELinuxMounts:       selinuxMounts,
+		Security:            security,
+		Volume:              workspaceVolume.Build(id),
+		TopologyConstraints: waitForFirstConsumerTopology(k.workspaceVolumeOptions()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &KubeManifest{
+		Pod: pod,
+		PVC: buildPvcManifest(workspaceVolume, id, parsedConfig, mergedConfig, imageName, workspaceMount, labels, imageDetails),
+	}
+	if serviceAccountName != "" {
+		manifest.ServiceAccount = &corev1.ServiceAccount{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ServiceAccount",
+				APIVersion: corev1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   serviceAccountName,
+				Labels: DevPodLabels,
+			},
+		}
+	}
+
+	return manifest, nil
+}
+
+// ApplyKubeManifest creates the ServiceAccount, PVC and Pod from a manifest
+// loaded with LoadManifestFile, so `devpod up --kube-file <file>` consumes a
+// manifest `devpod generate kube` produced earlier instead of re-deriving the
+// pod spec from the devcontainer config.
+func (k *kubernetesDriver) ApplyKubeManifest(ctx context.Context, manifest *KubeManifest) error {
+	kubeClient := k.kubeClient()
+
+	if k.namespace != "" && k.config.CreateNamespace == "true" {
+		k.Log.Debugf("Create namespace '%s'", k.namespace)
+		if err := kubeClient.CreateNamespace(ctx, k.namespace); err != nil {
+			k.Log.Debugf("Error creating namespace: %v", err)
+		}
+	}
+
+	if manifest.ServiceAccount != nil {
+		if _, err := kubeClient.CreateServiceAccount(ctx, k.namespace, manifest.ServiceAccount.Name); err != nil {
+			return fmt.Errorf("create service account: %w", err)
+		}
+	}
+
+	if manifest.PVC != nil {
+		if _, err := kubeClient.CreatePVC(ctx, k.namespace, manifest.PVC); err != nil {
+			return errors.Wrap(err, "create pvc")
+		}
+	}
+
+	k.Log.Infof("Create Pod '%s'", manifest.Pod.Name)
+	if _, err := kubeClient.CreatePod(ctx, k.namespace, manifest.Pod); err != nil {
+		return errors.Wrap(err, "create pod")
+	}
+
+	k.Log.Infof("Waiting for DevContainer Pod '%s' to come up...", manifest.Pod.Name)
+	_, err := kubeClient.WaitPodRunning(ctx, k.namespace, manifest.Pod.Name)
+	return err
+}
+
 func (k *kubernetesDriver) StartDevContainer(ctx context.Context, id string, labels []string) error {
-	_, containerInfo, err := k.getDevContainerPvc(ctx, id)
+	configMap, err := k.kubeClient().GetConfigMap(ctx, k.namespace, devContainerInfoConfigMapName(id))
+	if err != nil {
+		return err
+	} else if configMap == nil {
+		return fmt.Errorf("devcontainer info for workspace '%s' not found", id)
+	}
+
+	containerInfo, err := devContainerInfoFromConfigMap(configMap)
 	if err != nil {
 		return err
 	} else if containerInfo == nil {
-		return fmt.Errorf("persistent volume '%s' not found", id)
+		return fmt.Errorf("devcontainer info for workspace '%s' not found", id)
 	}
 
 	return k.runContainer(
@@ -273,5 +491,6 @@ func (k *kubernetesDriver) StartDevContainer(ctx context.Context, id string, lab
 		containerInfo.WorkspaceMount,
 		containerInfo.ImageDetails,
 		false,
+		containerInfo.WorkspaceVolumeBackend,
 	)
 }
@@ -0,0 +1,201 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodSecurityStandard is one of the Kubernetes Pod Security Admission levels.
+// Setting it on the driver config picks sane RunAsUser/RunAsGroup/seccomp
+// defaults so users can just say "restricted" and get a compliant pod instead
+// of hand-assembling every SecurityContext field.
+type PodSecurityStandard string
+
+const (
+	PodSecurityStandardPrivileged PodSecurityStandard = "privileged"
+	PodSecurityStandardBaseline   PodSecurityStandard = "baseline"
+	PodSecurityStandardRestricted PodSecurityStandard = "restricted"
+)
+
+// SecurityOptions controls how runContainer builds the pod's security
+// contexts. It is parsed from the provider options only; no per-workspace
+// setting (such as a devcontainer feature) overrides it. This lets clusters
+// with restricted PodSecurity admission or OpenShift SCCs run devpod without
+// the container unconditionally running as root.
+type SecurityOptions struct {
+	Standard                 PodSecurityStandard
+	PodSecurityContext       *corev1.PodSecurityContext
+	SecurityContext          *corev1.SecurityContext
+	RunAsUser                *int64
+	RunAsGroup               *int64
+	FSGroup                  *int64
+	SeccompProfile           *corev1.SeccompProfile
+	AllowPrivilegeEscalation *bool
+}
+
+// standardDefaults returns the RunAsUser/RunAsGroup/SeccompProfile/dropped-
+// capabilities a PodSecurityStandard preset implies. Explicit fields on
+// SecurityOptions always take precedence over these.
+func (s PodSecurityStandard) standardDefaults() (runAsUser, runAsGroup *int64, runAsNonRoot bool, allowPrivilegeEscalation bool, seccomp *corev1.SeccompProfile, dropCapabilities []corev1.Capability) {
+	switch s {
+	case PodSecurityStandardRestricted:
+		// The restricted Pod Security Standard requires every capability to
+		// be dropped - a pod that still holds any Linux capability is
+		// rejected outright by a cluster actually enforcing it.
+		return ptrInt64(1000), ptrInt64(1000), true, false, &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}, []corev1.Capability{"ALL"}
+	case PodSecurityStandardBaseline:
+		return ptrInt64(1000), ptrInt64(1000), false, true, nil, nil
+	default: // privileged, or unset
+		return ptrInt64(0), ptrInt64(0), false, true, nil, nil
+	}
+}
+
+// resolveSecurityContext merges the PodSecurityStandard preset with explicit
+// overrides into the pod- and container-level SecurityContext.
+func resolveSecurityContext(opts *SecurityOptions, capabilities *corev1.Capabilities, privileged *bool) (*corev1.PodSecurityContext, *corev1.SecurityContext) {
+	if opts == nil {
+		opts = &SecurityOptions{}
+	}
+
+	runAsUser, runAsGroup, runAsNonRoot, allowPrivilegeEscalation, seccomp, dropCapabilities := opts.Standard.standardDefaults()
+	if opts.RunAsUser != nil {
+		runAsUser = opts.RunAsUser
+	}
+	if opts.RunAsGroup != nil {
+		runAsGroup = opts.RunAsGroup
+	}
+	if opts.SeccompProfile != nil {
+		seccomp = opts.SeccompProfile
+	}
+	if opts.AllowPrivilegeEscalation != nil {
+		allowPrivilegeEscalation = *opts.AllowPrivilegeEscalation
+	}
+	if privileged == nil {
+		unprivileged := false
+		privileged = &unprivileged
+	}
+
+	if len(dropCapabilities) > 0 {
+		if capabilities == nil {
+			capabilities = &corev1.Capabilities{}
+		}
+		capabilities.Drop = dropCapabilities
+	}
+
+	if opts.Standard == PodSecurityStandardRestricted {
+		// The restricted standard only permits NET_BIND_SERVICE to be added
+		// back and forbids privileged containers outright - a devcontainer
+		// that sets capAdd or privileged: true alongside this standard would
+		// otherwise silently produce a pod a cluster enforcing it rejects.
+		if capabilities != nil {
+			capabilities.Add = restrictedAllowedCapabilities(capabilities.Add)
+		}
+		unprivileged := false
+		privileged = &unprivileged
+	}
+
+	podSecurityContext := opts.PodSecurityContext
+	if podSecurityContext == nil {
+		podSecurityContext = &corev1.PodSecurityContext{
+			FSGroup:        opts.FSGroup,
+			SeccompProfile: seccomp,
+		}
+	}
+
+	// Copied so callers can set fields on the result without writing into the
+	// driver config the explicit SecurityContext came from.
+	securityContext := opts.SecurityContext.DeepCopy()
+	if securityContext == nil {
+		securityContext = &corev1.SecurityContext{
+			Capabilities:             capabilities,
+			Privileged:               privileged,
+			RunAsUser:                runAsUser,
+			RunAsGroup:               runAsGroup,
+			RunAsNonRoot:             &runAsNonRoot,
+			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		}
+	}
+
+	return podSecurityContext, securityContext
+}
+
+func ptrInt64(v int64) *int64 {
+	return &v
+}
+
+// restrictedAllowedCapabilities filters add down to the only capability the
+// restricted Pod Security Standard permits a container to add back.
+func restrictedAllowedCapabilities(add []corev1.Capability) []corev1.Capability {
+	var allowed []corev1.Capability
+	for _, c := range add {
+		if c == corev1.Capability("NET_BIND_SERVICE") {
+			allowed = append(allowed, c)
+		}
+	}
+
+	return allowed
+}
+
+// securityOptions reads the PodSecurityContext/SecurityContext fields parsed
+// from the provider options into a SecurityOptions the builder understands.
+func (k *kubernetesDriver) securityOptions() *SecurityOptions {
+	return &SecurityOptions{
+		Standard:                 PodSecurityStandard(k.config.PodSecurityStandard),
+		PodSecurityContext:       k.config.PodSecurityContext,
+		SecurityContext:          k.config.SecurityContext,
+		RunAsUser:                k.config.RunAsUser,
+		RunAsGroup:               k.config.RunAsGroup,
+		FSGroup:                  k.config.FSGroup,
+		SeccompProfile:           k.config.SeccompProfile,
+		AllowPrivilegeEscalation: k.config.AllowPrivilegeEscalation,
+	}
+}
+
+// effectiveUserGroup resolves the UID/GID the chown init container hands the
+// PVC to: the PodSecurityStandard preset's default (e.g. 1000 for restricted
+// and baseline), overridden by any explicit RunAsUser/RunAsGroup. The UID is
+// the one the container runs as. When only RunAsUser is set, the GID is that
+// UID, whereas resolveSecurityContext keeps the preset's RunAsGroup for the
+// container. This is what
+// the chown-init-container gate needs - checking the raw RunAsUser field
+// alone misses users who only set PodSecurityStandard and rely on its UID
+// default, leaving them with a non-root container against a root-owned PVC.
+func (s *SecurityOptions) effectiveUserGroup() (uid, gid int64) {
+	defaultUser, defaultGroup, _, _, _, _ := s.Standard.standardDefaults()
+	uid, gid = *defaultUser, *defaultGroup
+
+	if s.RunAsUser != nil {
+		uid = *s.RunAsUser
+	}
+	if s.RunAsGroup != nil {
+		gid = *s.RunAsGroup
+	} else if s.RunAsUser != nil {
+		gid = uid
+	}
+
+	return uid, gid
+}
+
+// buildChownInitContainer chowns the PVC's devpod/ subpaths to the configured
+// non-root user before the dev container starts, since a freshly provisioned
+// PVC is root-owned by default.
+func buildChownInitContainer(imageName string, uid, gid int64, volumeMounts []corev1.VolumeMount) corev1.Container {
+	paths := make([]string, 0, len(volumeMounts))
+	for _, vm := range volumeMounts {
+		paths = append(paths, vm.MountPath)
+	}
+
+	return corev1.Container{
+		Name:         "devpod-chown",
+		Image:        imageName,
+		Command:      []string{"sh", "-c"},
+		Args:         []string{fmt.Sprintf("chown -R %d:%d %s", uid, gid, strings.Join(paths, " "))},
+		VolumeMounts: volumeMounts,
+		SecurityContext: &corev1.SecurityContext{
+			RunAsUser:  ptrInt64(0),
+			RunAsGroup: ptrInt64(0),
+		},
+	}
+}
@@ -0,0 +1,110 @@
+package kubernetes
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestResolveSecurityContextStandards(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           *SecurityOptions
+		privileged     *bool
+		wantRunAsUser  int64
+		wantPrivileged bool
+		wantDropAll    bool
+	}{
+		{
+			name:           "unset defaults to root and privileged allowed",
+			opts:           &SecurityOptions{},
+			privileged:     nil,
+			wantRunAsUser:  0,
+			wantPrivileged: false,
+			wantDropAll:    false,
+		},
+		{
+			name:           "baseline defaults to uid 1000, leaves privileged alone",
+			opts:           &SecurityOptions{Standard: PodSecurityStandardBaseline},
+			privileged:     boolPtr(true),
+			wantRunAsUser:  1000,
+			wantPrivileged: true,
+			wantDropAll:    false,
+		},
+		{
+			name:           "restricted defaults to uid 1000, drops all capabilities, forces unprivileged",
+			opts:           &SecurityOptions{Standard: PodSecurityStandardRestricted},
+			privileged:     boolPtr(true),
+			wantRunAsUser:  1000,
+			wantPrivileged: false,
+			wantDropAll:    true,
+		},
+		{
+			name:           "explicit RunAsUser overrides the standard's default",
+			opts:           &SecurityOptions{Standard: PodSecurityStandardRestricted, RunAsUser: ptrInt64(2000)},
+			privileged:     nil,
+			wantRunAsUser:  2000,
+			wantPrivileged: false,
+			wantDropAll:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, securityContext := resolveSecurityContext(tt.opts, nil, tt.privileged)
+
+			if securityContext.RunAsUser == nil || *securityContext.RunAsUser != tt.wantRunAsUser {
+				t.Errorf("RunAsUser = %v, want %d", securityContext.RunAsUser, tt.wantRunAsUser)
+			}
+			if securityContext.Privileged == nil || *securityContext.Privileged != tt.wantPrivileged {
+				t.Errorf("Privileged = %v, want %v", securityContext.Privileged, tt.wantPrivileged)
+			}
+
+			droppedAll := securityContext.Capabilities != nil && len(securityContext.Capabilities.Drop) == 1 && securityContext.Capabilities.Drop[0] == "ALL"
+			if droppedAll != tt.wantDropAll {
+				t.Errorf("dropped ALL capabilities = %v, want %v", droppedAll, tt.wantDropAll)
+			}
+		})
+	}
+}
+
+func TestResolveSecurityContextRestrictedFiltersCapAddAndPrivileged(t *testing.T) {
+	opts := &SecurityOptions{Standard: PodSecurityStandardRestricted}
+	capabilities := &corev1.Capabilities{Add: []corev1.Capability{"NET_BIND_SERVICE", "SYS_ADMIN"}}
+
+	_, securityContext := resolveSecurityContext(opts, capabilities, boolPtr(true))
+
+	if got := securityContext.Capabilities.Add; len(got) != 1 || got[0] != "NET_BIND_SERVICE" {
+		t.Errorf("Capabilities.Add = %v, want only NET_BIND_SERVICE", got)
+	}
+	if securityContext.Privileged == nil || *securityContext.Privileged {
+		t.Errorf("Privileged = %v, want false under the restricted standard", securityContext.Privileged)
+	}
+}
+
+func TestEffectiveUserGroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *SecurityOptions
+		wantUID int64
+		wantGID int64
+	}{
+		{name: "unset", opts: &SecurityOptions{}, wantUID: 0, wantGID: 0},
+		{name: "restricted default", opts: &SecurityOptions{Standard: PodSecurityStandardRestricted}, wantUID: 1000, wantGID: 1000},
+		{name: "explicit RunAsUser without RunAsGroup", opts: &SecurityOptions{Standard: PodSecurityStandardRestricted, RunAsUser: ptrInt64(2000)}, wantUID: 2000, wantGID: 2000},
+		{name: "explicit RunAsUser and RunAsGroup", opts: &SecurityOptions{Standard: PodSecurityStandardRestricted, RunAsUser: ptrInt64(2000), RunAsGroup: ptrInt64(3000)}, wantUID: 2000, wantGID: 3000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uid, gid := tt.opts.effectiveUserGroup()
+			if uid != tt.wantUID || gid != tt.wantGID {
+				t.Errorf("effectiveUserGroup() = (%d, %d), want (%d, %d)", uid, gid, tt.wantUID, tt.wantGID)
+			}
+		})
+	}
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
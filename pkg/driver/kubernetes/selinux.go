@@ -0,0 +1,131 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SELinuxMountsAnnotation stores the raw `:z`/`:Z`/`selinux=...` mount options
+// devpod received, keyed by the target path inside the container. Kubernetes'
+// VolumeMount has no field for them, so - the same way podman's generate/play
+// kube tucks SELinux info into annotations - we record them on the pod for
+// external tooling (kubectl describe, `devpod generate kube` consumers) to
+// inspect. devpod itself doesn't re-parse this annotation on restart: it
+// recomputes the same tokens from the persisted DevContainerInfo.MergedConfig
+// mounts (see collectSELinuxMounts), which is the actual durable source of
+// truth the annotation was derived from in the first place.
+const SELinuxMountsAnnotation = "devpod.sh/selinux-mounts"
+
+// seLinuxMountOption is the raw SELinux token a user put on a mount, e.g. "z",
+// "Z", or "selinux=level:s0:c1,c2,type:container_file_t".
+func seLinuxMountOption(mount *config.Mount) (string, bool) {
+	tokens := strings.Split(mount.String(), ",")
+	for i, token := range tokens {
+		token = strings.TrimSpace(token)
+		if token == "z" || token == "Z" {
+			return token, true
+		} else if strings.HasPrefix(token, "selinux=") {
+			// The selinux= value's own fields are comma-separated too, so the
+			// tokens after it up to the next key=value option belong to it.
+			fields := []string{token}
+			for _, next := range tokens[i+1:] {
+				next = strings.TrimSpace(next)
+				if strings.Contains(next, "=") || next == "z" || next == "Z" {
+					break
+				}
+				fields = append(fields, next)
+			}
+			return strings.Join(fields, ","), true
+		}
+	}
+
+	return "", false
+}
+
+// collectSELinuxMounts scans the workspace mount and the merged devcontainer
+// mounts for SELinux options and returns them keyed by their target path.
+func collectSELinuxMounts(mount *config.Mount, mounts []*config.Mount) map[string]string {
+	selinuxMounts := map[string]string{}
+	if token, ok := seLinuxMountOption(mount); ok {
+		selinuxMounts[mount.Target] = token
+	}
+
+	for _, m := range mounts {
+		if token, ok := seLinuxMountOption(m); ok {
+			selinuxMounts[m.Target] = token
+		}
+	}
+
+	return selinuxMounts
+}
+
+// selinuxMountsAnnotation marshals the collected SELinux mount tokens into the
+// devpod.sh/selinux-mounts annotation, or returns nil if there's nothing to
+// round-trip.
+func selinuxMountsAnnotation(selinuxMounts map[string]string) map[string]string {
+	if len(selinuxMounts) == 0 {
+		return nil
+	}
+
+	raw, err := json.Marshal(selinuxMounts)
+	if err != nil {
+		return nil
+	}
+
+	return map[string]string{
+		SELinuxMountsAnnotation: string(raw),
+	}
+}
+
+// seLinuxOptionsFromMounts derives container-wide corev1.SELinuxOptions from the
+// collected mount tokens. Only the "selinux=level:...,type:...,role:...,user:..."
+// form maps onto Kubernetes' Level/Type/Role/User fields; bare "z"/"Z" tokens are
+// preserved in the annotation only, since they don't carry a specific context.
+//
+// When more than one mount carries a selinux= token, the mount with the
+// lexicographically greatest target path wins each field - selinuxMounts is a
+// map, so iterating it directly would make that precedence depend on Go's
+// randomized map order instead.
+func seLinuxOptionsFromMounts(selinuxMounts map[string]string) *corev1.SELinuxOptions {
+	targets := make([]string, 0, len(selinuxMounts))
+	for target := range selinuxMounts {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	var opts *corev1.SELinuxOptions
+	for _, target := range targets {
+		token := selinuxMounts[target]
+		if !strings.HasPrefix(token, "selinux=") {
+			continue
+		}
+
+		if opts == nil {
+			opts = &corev1.SELinuxOptions{}
+		}
+
+		for _, field := range strings.Split(strings.TrimPrefix(token, "selinux="), ",") {
+			key, value, found := strings.Cut(field, ":")
+			if !found {
+				continue
+			}
+
+			switch strings.ToLower(key) {
+			case "level":
+				opts.Level = value
+			case "type":
+				opts.Type = value
+			case "role":
+				opts.Role = value
+			case "user":
+				opts.User = value
+			}
+		}
+	}
+
+	return opts
+}
@@ -0,0 +1,49 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+)
+
+func TestSeLinuxOptionsFromMountsDeterministic(t *testing.T) {
+	selinuxMounts := map[string]string{
+		"/workspace": "selinux=level:s0:c1,c2,type:container_file_t",
+		"/data":      "selinux=level:s0:c3,c4,type:other_file_t",
+	}
+
+	first := seLinuxOptionsFromMounts(selinuxMounts)
+	for i := 0; i < 10; i++ {
+		got := seLinuxOptionsFromMounts(selinuxMounts)
+		if got.Type != first.Type || got.Level != first.Level {
+			t.Fatalf("seLinuxOptionsFromMounts is not deterministic: got %+v, want %+v", got, first)
+		}
+	}
+
+	// The lexicographically greatest target ("/workspace") wins.
+	if first.Type != "container_file_t" {
+		t.Errorf("Type = %q, want %q", first.Type, "container_file_t")
+	}
+}
+
+func TestSeLinuxOptionsFromMountsIgnoresBareTokens(t *testing.T) {
+	opts := seLinuxOptionsFromMounts(map[string]string{"/workspace": "z"})
+	if opts != nil {
+		t.Errorf("bare z/Z tokens carry no context, expected nil opts, got %+v", opts)
+	}
+}
+
+func TestCollectSELinuxMounts(t *testing.T) {
+	mount := &config.Mount{Target: "/workspace", Type: "bind", Source: "/host:/workspace:z"}
+	extra := []*config.Mount{
+		{Target: "/data", Type: "volume", Source: "data-vol"},
+	}
+
+	got := collectSELinuxMounts(mount, extra)
+	if _, ok := got["/workspace"]; !ok {
+		t.Errorf("expected /workspace to carry an SELinux token, got %+v", got)
+	}
+	if _, ok := got["/data"]; ok {
+		t.Errorf("did not expect /data to carry an SELinux token, got %+v", got)
+	}
+}
@@ -0,0 +1,241 @@
+package kubernetes
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	storagev1 "k8s.io/api/storage/v1"
+)
+
+// WorkspaceVolumeBackend selects how the workspace's contents get onto the
+// pod. It's chosen via a provider option and recorded in the DevContainerInfo
+// so StartDevContainer reconstructs the same volume topology
+// later, even if the provider option has since changed.
+type WorkspaceVolumeBackend string
+
+const (
+	// WorkspaceVolumeBackendPVC is today's default: devpod provisions a PVC
+	// and copies the local workspace into it via `kubectl cp` on first init.
+	WorkspaceVolumeBackendPVC WorkspaceVolumeBackend = "pvc"
+	// WorkspaceVolumeBackendCSI mounts a user-named StorageClass or existing
+	// PVC as subPath: devpod/0, skipping the copy step entirely.
+	WorkspaceVolumeBackendCSI WorkspaceVolumeBackend = "csi"
+	// WorkspaceVolumeBackendNetworkFS mounts a shared filesystem
+	// (JuiceFS/NFS/SMB) via a CSI driver directly on the pod, so the
+	// workspace is naturally cluster-shared and survives pod deletion.
+	WorkspaceVolumeBackendNetworkFS WorkspaceVolumeBackend = "network-fs"
+)
+
+// WorkspaceVolumeOptions is parsed from the provider options and picks the
+// workspace volume backend plus its knobs. Only the backend is persisted, as
+// DevContainerInfo.WorkspaceVolumeBackend, so the workspace keeps its original
+// backend across `devpod up`/StartDevContainer even if the provider option
+// changes; the other knobs are read from the provider options each time.
+type WorkspaceVolumeOptions struct {
+	Backend WorkspaceVolumeBackend `json:"backend,omitempty"`
+
+	// PVC backend
+	StorageSize string `json:"storageSize,omitempty"`
+
+	// CSI inline backend
+	ClaimName    string `json:"claimName,omitempty"`
+	StorageClass string `json:"storageClass,omitempty"`
+
+	// Network-FS backend
+	CSIDriver        string            `json:"csiDriver,omitempty"`
+	VolumeHandle     string            `json:"volumeHandle,omitempty"`
+	VolumeAttributes map[string]string `json:"volumeAttributes,omitempty"`
+	ReadOnly         bool              `json:"readOnly,omitempty"`
+
+	// Shared knobs: cooperate with WaitForFirstConsumer so the pod's node
+	// selector doesn't race the volume's topology constraints.
+	VolumeBindingMode   storagev1.VolumeBindingMode `json:"volumeBindingMode,omitempty"`
+	TopologyConstraints map[string]string           `json:"topologyConstraints,omitempty"`
+}
+
+// WorkspaceVolume builds the corev1.Volume (and, for the PVC backend, the
+// PersistentVolumeClaim) backing the workspace, and reports whether its
+// contents still need to be populated with `kubectl cp`/exec-stream on first
+// use.
+type WorkspaceVolume interface {
+	Backend() WorkspaceVolumeBackend
+	Build(id string) corev1.Volume
+	// BuildPVC returns the PVC to provision, or nil if the backend doesn't
+	// provision one itself (CSI-inline names an existing claim/StorageClass,
+	// network-fs is backed entirely by the CSI driver).
+	BuildPVC(id string, labels map[string]string, annotations map[string]string) *corev1.PersistentVolumeClaim
+	// NeedsCopy reports whether the local workspace must be copied in on
+	// first init, or whether the backend's storage already has it (e.g. a
+	// pre-populated CSI claim or shared network filesystem).
+	NeedsCopy() bool
+}
+
+// workspaceVolumeOptions reads the workspace volume backend and its knobs
+// from the provider options.
+func (k *kubernetesDriver) workspaceVolumeOptions() *WorkspaceVolumeOptions {
+	return &WorkspaceVolumeOptions{
+		Backend:             WorkspaceVolumeBackend(k.config.WorkspaceVolumeBackend),
+		StorageSize:         k.config.WorkspaceVolumeStorageSize,
+		ClaimName:           k.config.WorkspaceVolumeClaimName,
+		StorageClass:        k.config.WorkspaceVolumeStorageClass,
+		CSIDriver:           k.config.WorkspaceVolumeCSIDriver,
+		VolumeHandle:        k.config.WorkspaceVolumeHandle,
+		VolumeAttributes:    k.config.WorkspaceVolumeAttributes,
+		VolumeBindingMode:   storagev1.VolumeBindingMode(k.config.VolumeBindingMode),
+		TopologyConstraints: k.config.TopologyConstraints,
+	}
+}
+
+// waitForFirstConsumerTopology returns the topology constraints to merge into
+// the pod's node selector, but only when the volume uses
+// VolumeBindingWaitForFirstConsumer - otherwise the volume already bound
+// independent of the pod's node, and the constraints would just needlessly
+// narrow scheduling.
+func waitForFirstConsumerTopology(opts *WorkspaceVolumeOptions) map[string]string {
+	if opts.VolumeBindingMode != storagev1.VolumeBindingWaitForFirstConsumer {
+		return nil
+	}
+
+	return opts.TopologyConstraints
+}
+
+// NewWorkspaceVolume builds the WorkspaceVolume for the configured backend.
+func NewWorkspaceVolume(opts *WorkspaceVolumeOptions) WorkspaceVolume {
+	switch opts.Backend {
+	case WorkspaceVolumeBackendCSI:
+		return &csiInlineWorkspaceVolume{opts: opts}
+	case WorkspaceVolumeBackendNetworkFS:
+		return &networkFSWorkspaceVolume{opts: opts}
+	default:
+		return &pvcWorkspaceVolume{opts: opts}
+	}
+}
+
+type pvcWorkspaceVolume struct {
+	opts *WorkspaceVolumeOptions
+}
+
+func (v *pvcWorkspaceVolume) Backend() WorkspaceVolumeBackend { return WorkspaceVolumeBackendPVC }
+func (v *pvcWorkspaceVolume) NeedsCopy() bool                 { return true }
+
+func (v *pvcWorkspaceVolume) Build(id string) corev1.Volume {
+	return corev1.Volume{
+		Name: "devpod",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: id,
+			},
+		},
+	}
+}
+
+func (v *pvcWorkspaceVolume) BuildPVC(id string, labels, annotations map[string]string) *corev1.PersistentVolumeClaim {
+	storageSize := v.opts.StorageSize
+	if storageSize == "" {
+		storageSize = "10Gi"
+	}
+
+	return &corev1.PersistentVolumeClaim{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PersistentVolumeClaim",
+			APIVersion: corev1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        id,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse(storageSize),
+				},
+			},
+		},
+	}
+}
+
+// csiInlineWorkspaceVolume names an existing PVC or StorageClass and mounts it
+// as subPath: devpod/0, so the workspace is cluster-shared and survives
+// rescheduling without devpod copying anything in.
+type csiInlineWorkspaceVolume struct {
+	opts *WorkspaceVolumeOptions
+}
+
+func (v *csiInlineWorkspaceVolume) Backend() WorkspaceVolumeBackend { return WorkspaceVolumeBackendCSI }
+func (v *csiInlineWorkspaceVolume) NeedsCopy() bool                 { return false }
+
+func (v *csiInlineWorkspaceVolume) Build(id string) corev1.Volume {
+	claimName := v.opts.ClaimName
+	if claimName == "" {
+		claimName = id
+	}
+
+	return corev1.Volume{
+		Name: "devpod",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: claimName,
+			},
+		},
+	}
+}
+
+func (v *csiInlineWorkspaceVolume) BuildPVC(id string, labels, annotations map[string]string) *corev1.PersistentVolumeClaim {
+	// An existing claim was named explicitly - nothing for devpod to provision.
+	if v.opts.ClaimName != "" {
+		return nil
+	}
+
+	storageClass := v.opts.StorageClass
+	return &corev1.PersistentVolumeClaim{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PersistentVolumeClaim",
+			APIVersion: corev1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        id,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: &storageClass,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse("10Gi"),
+				},
+			},
+		},
+	}
+}
+
+// networkFSWorkspaceVolume mounts a shared filesystem (JuiceFS/NFS/SMB) via a
+// CSI driver directly on the pod, using CSIVolumeSource, so the workspace is
+// naturally cluster-shared without devpod provisioning any storage itself.
+type networkFSWorkspaceVolume struct {
+	opts *WorkspaceVolumeOptions
+}
+
+func (v *networkFSWorkspaceVolume) Backend() WorkspaceVolumeBackend {
+	return WorkspaceVolumeBackendNetworkFS
+}
+func (v *networkFSWorkspaceVolume) NeedsCopy() bool { return false }
+
+func (v *networkFSWorkspaceVolume) Build(id string) corev1.Volume {
+	return corev1.Volume{
+		Name: "devpod",
+		VolumeSource: corev1.VolumeSource{
+			CSI: &corev1.CSIVolumeSource{
+				Driver:           v.opts.CSIDriver,
+				ReadOnly:         &v.opts.ReadOnly,
+				VolumeAttributes: v.opts.VolumeAttributes,
+			},
+		},
+	}
+}
+
+func (v *networkFSWorkspaceVolume) BuildPVC(string, map[string]string, map[string]string) *corev1.PersistentVolumeClaim {
+	return nil
+}
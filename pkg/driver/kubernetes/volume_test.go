@@ -0,0 +1,123 @@
+package kubernetes
+
+import (
+	"testing"
+
+	storagev1 "k8s.io/api/storage/v1"
+)
+
+func TestNewWorkspaceVolumeBackend(t *testing.T) {
+	tests := []struct {
+		backend WorkspaceVolumeBackend
+		want    WorkspaceVolumeBackend
+	}{
+		{backend: WorkspaceVolumeBackendPVC, want: WorkspaceVolumeBackendPVC},
+		{backend: WorkspaceVolumeBackendCSI, want: WorkspaceVolumeBackendCSI},
+		{backend: WorkspaceVolumeBackendNetworkFS, want: WorkspaceVolumeBackendNetworkFS},
+		{backend: "", want: WorkspaceVolumeBackendPVC},
+	}
+
+	for _, tt := range tests {
+		volume := NewWorkspaceVolume(&WorkspaceVolumeOptions{Backend: tt.backend})
+		if got := volume.Backend(); got != tt.want {
+			t.Errorf("backend %q: got %q, want %q", tt.backend, got, tt.want)
+		}
+	}
+}
+
+func TestPvcWorkspaceVolume(t *testing.T) {
+	volume := NewWorkspaceVolume(&WorkspaceVolumeOptions{Backend: WorkspaceVolumeBackendPVC})
+	if !volume.NeedsCopy() {
+		t.Error("pvc backend should need a copy on first init")
+	}
+
+	pvc := volume.BuildPVC("my-id", nil, nil)
+	if pvc == nil {
+		t.Fatal("pvc backend should provision a PVC")
+	}
+	if pvc.Name != "my-id" {
+		t.Errorf("pvc name = %q, want %q", pvc.Name, "my-id")
+	}
+
+	vol := volume.Build("my-id")
+	if vol.PersistentVolumeClaim == nil || vol.PersistentVolumeClaim.ClaimName != "my-id" {
+		t.Errorf("volume should mount the provisioned PVC by id, got %+v", vol)
+	}
+}
+
+func TestCsiInlineWorkspaceVolume(t *testing.T) {
+	t.Run("named claim provisions nothing", func(t *testing.T) {
+		volume := NewWorkspaceVolume(&WorkspaceVolumeOptions{Backend: WorkspaceVolumeBackendCSI, ClaimName: "existing-claim"})
+		if volume.NeedsCopy() {
+			t.Error("csi-inline backend should never need a copy")
+		}
+		if pvc := volume.BuildPVC("my-id", nil, nil); pvc != nil {
+			t.Errorf("named claim should not provision a PVC, got %+v", pvc)
+		}
+
+		vol := volume.Build("my-id")
+		if vol.PersistentVolumeClaim == nil || vol.PersistentVolumeClaim.ClaimName != "existing-claim" {
+			t.Errorf("volume should mount the named claim, got %+v", vol)
+		}
+	})
+
+	t.Run("no claim name provisions one named after the workspace", func(t *testing.T) {
+		volume := NewWorkspaceVolume(&WorkspaceVolumeOptions{Backend: WorkspaceVolumeBackendCSI, StorageClass: "fast"})
+		pvc := volume.BuildPVC("my-id", nil, nil)
+		if pvc == nil {
+			t.Fatal("expected a provisioned PVC when no claim name is given")
+		}
+		if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName != "fast" {
+			t.Errorf("pvc storage class = %v, want %q", pvc.Spec.StorageClassName, "fast")
+		}
+
+		vol := volume.Build("my-id")
+		if vol.PersistentVolumeClaim.ClaimName != "my-id" {
+			t.Errorf("volume should mount the PVC named after the workspace, got %+v", vol)
+		}
+	})
+}
+
+func TestNetworkFSWorkspaceVolume(t *testing.T) {
+	volume := NewWorkspaceVolume(&WorkspaceVolumeOptions{
+		Backend:          WorkspaceVolumeBackendNetworkFS,
+		CSIDriver:        "juicefs.csi.com",
+		VolumeAttributes: map[string]string{"subPath": "devpod"},
+	})
+
+	if volume.NeedsCopy() {
+		t.Error("network-fs backend should never need a copy")
+	}
+	if pvc := volume.BuildPVC("my-id", nil, nil); pvc != nil {
+		t.Errorf("network-fs backend should not provision a PVC, got %+v", pvc)
+	}
+
+	vol := volume.Build("my-id")
+	if vol.CSI == nil || vol.CSI.Driver != "juicefs.csi.com" {
+		t.Errorf("volume should mount the configured CSI driver, got %+v", vol)
+	}
+}
+
+func TestWaitForFirstConsumerTopology(t *testing.T) {
+	constraints := map[string]string{"topology.kubernetes.io/zone": "us-east-1a"}
+
+	t.Run("immediate binding ignores topology", func(t *testing.T) {
+		got := waitForFirstConsumerTopology(&WorkspaceVolumeOptions{
+			VolumeBindingMode:   storagev1.VolumeBindingImmediate,
+			TopologyConstraints: constraints,
+		})
+		if got != nil {
+			t.Errorf("got %v, want nil", got)
+		}
+	})
+
+	t.Run("wait-for-first-consumer applies topology", func(t *testing.T) {
+		got := waitForFirstConsumerTopology(&WorkspaceVolumeOptions{
+			VolumeBindingMode:   storagev1.VolumeBindingWaitForFirstConsumer,
+			TopologyConstraints: constraints,
+		})
+		if got["topology.kubernetes.io/zone"] != "us-east-1a" {
+			t.Errorf("got %v, want %v", got, constraints)
+		}
+	})
+}